@@ -0,0 +1,130 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// storeFormat is the data format of an input or output store, independent
+// of how it was named (a file extension, or nothing at all for stdin/stdout).
+type storeFormat int
+
+const (
+	formatUnknown storeFormat = iota
+	formatJSON
+	formatYAML
+	formatEnv
+)
+
+func (f storeFormat) String() string {
+	switch f {
+	case formatJSON:
+		return "json"
+	case formatYAML:
+		return "yaml"
+	case formatEnv:
+		return "env"
+	default:
+		return "unknown"
+	}
+}
+
+func parseStoreFormat(s string) (storeFormat, error) {
+	switch strings.ToLower(s) {
+	case "json":
+		return formatJSON, nil
+	case "yaml", "yml":
+		return formatYAML, nil
+	case "env":
+		return formatEnv, nil
+	default:
+		return formatUnknown, fmt.Errorf("unknown -format %q (want json, yaml, or env)", s)
+	}
+}
+
+// storeFormatFromExt maps a file extension to a format, returning
+// formatUnknown for stdin ("-"), extension-less files, or anything not
+// recognized — callers should fall back to getStoreFormatFromData.
+func storeFormatFromExt(path string) storeFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".env":
+		return formatEnv
+	case ".json":
+		return formatJSON
+	case ".yaml", ".yml":
+		return formatYAML
+	default:
+		return formatUnknown
+	}
+}
+
+var dotenvLineRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*=`)
+
+// getStoreFormatFromData sniffs the format of raw content by trying JSON,
+// then YAML, then a dotenv heuristic (every non-blank, non-comment line
+// looks like KEY=value), in that order. This is what lets `-i -` and
+// extension-less or misnamed files work.
+func getStoreFormatFromData(data []byte) storeFormat {
+	trimmed := strings.TrimSpace(string(data))
+	if trimmed == "" {
+		return formatUnknown
+	}
+
+	var js interface{}
+	if json.Unmarshal([]byte(trimmed), &js) == nil {
+		return formatJSON
+	}
+
+	sawLine := false
+	looksLikeEnv := true
+	for _, line := range strings.Split(trimmed, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		sawLine = true
+		if !dotenvLineRe.MatchString(line) {
+			looksLikeEnv = false
+			break
+		}
+	}
+
+	var y interface{}
+	if yaml.Unmarshal([]byte(trimmed), &y) == nil {
+		if sawLine && looksLikeEnv {
+			return formatEnv
+		}
+		return formatYAML
+	}
+
+	if sawLine && looksLikeEnv {
+		return formatEnv
+	}
+	return formatUnknown
+}
+
+// readInputBytes reads path, treating "-" as stdin so inputs can come from
+// a Unix pipeline instead of only named files.
+func readInputBytes(path string) ([]byte, error) {
+	if path == "-" {
+		return io.ReadAll(os.Stdin)
+	}
+	return os.ReadFile(path)
+}
+
+// writeOutput writes data to path, treating "-" as stdout so output can
+// feed straight into the next stage of a pipeline.
+func writeOutput(path string, data []byte) error {
+	if path == "-" {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(path, data, 0644)
+}
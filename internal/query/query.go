@@ -0,0 +1,133 @@
+// Package query implements selection, assignment, and deletion over the
+// flat-key maps vaultboy works with (keys like "foo.bar[0].baz"), so a
+// subtree of a large Vault export can be extracted or reshaped without
+// post-processing the JSON by hand.
+package query
+
+import "strings"
+
+// segment is one dot-separated piece of a flat key, optionally carrying an
+// array index ("host" vs "services[0]").
+type segment struct {
+	name     string
+	index    string
+	hasIndex bool
+}
+
+func splitKey(key string) []segment {
+	parts := strings.Split(key, ".")
+	segs := make([]segment, len(parts))
+	for i, part := range parts {
+		name, idx, isArray := splitIndex(part)
+		segs[i] = segment{name: name, index: idx, hasIndex: isArray}
+	}
+	return segs
+}
+
+func splitIndex(part string) (name, index string, hasIndex bool) {
+	if strings.HasSuffix(part, "]") {
+		if b := strings.LastIndex(part, "["); b != -1 {
+			return part[:b], part[b+1 : len(part)-1], true
+		}
+	}
+	return part, "", false
+}
+
+// matchSegment reports whether a pattern segment matches a key segment.
+// "*" in the name position matches any name; "*" in the index position
+// matches any index. A pattern segment with no brackets only matches a key
+// segment with no brackets.
+func matchSegment(pat, key segment) bool {
+	if pat.name != "*" && pat.name != key.name {
+		return false
+	}
+	if pat.hasIndex != key.hasIndex {
+		return false
+	}
+	if pat.hasIndex && pat.index != "*" && pat.index != key.index {
+		return false
+	}
+	return true
+}
+
+// Match reports whether flatKey matches pattern, where pattern uses the
+// same "foo.bar[0].baz" grammar as a flat key plus "*" wildcards for a
+// name or an array index.
+func Match(pattern, flatKey string) bool {
+	patSegs := splitKey(pattern)
+	keySegs := splitKey(flatKey)
+	if len(patSegs) != len(keySegs) {
+		return false
+	}
+	for i := range patSegs {
+		if !matchSegment(patSegs[i], keySegs[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// Select returns the subset of data whose keys match patterns. A pattern
+// prefixed with "!" excludes matching keys instead of including them, and
+// is applied after all inclusion patterns. If patterns contains no plain
+// (non-"!") pattern, every key is included by default and only the
+// exclusions are applied.
+func Select(data map[string]interface{}, patterns []string) map[string]interface{} {
+	var include, exclude []string
+	for _, p := range patterns {
+		if strings.HasPrefix(p, "!") {
+			exclude = append(exclude, strings.TrimPrefix(p, "!"))
+		} else {
+			include = append(include, p)
+		}
+	}
+
+	result := make(map[string]interface{})
+	for k, v := range data {
+		keep := len(include) == 0
+		for _, p := range include {
+			if Match(p, k) {
+				keep = true
+				break
+			}
+		}
+		for _, p := range exclude {
+			if Match(p, k) {
+				keep = false
+				break
+			}
+		}
+		if keep {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// Set returns a copy of data with key set to value.
+func Set(data map[string]interface{}, key string, value interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(data)+1)
+	for k, v := range data {
+		result[k] = v
+	}
+	result[key] = value
+	return result
+}
+
+// Delete returns the subset of data whose keys match none of patterns.
+func Delete(data map[string]interface{}, patterns []string) map[string]interface{} {
+	result := make(map[string]interface{})
+	for k, v := range data {
+		matched := false
+		for _, p := range patterns {
+			if Match(p, k) {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			result[k] = v
+		}
+	}
+	return result
+}
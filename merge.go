@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// fileMergeStrategy controls how keys that appear in more than one -i input
+// are combined, the cross-file counterpart to docMergeStrategy (which only
+// handles multiple documents within a single YAML file).
+type fileMergeStrategy string
+
+const (
+	mergeOverride fileMergeStrategy = "override"
+	mergeAppend   fileMergeStrategy = "append"
+	mergeError    fileMergeStrategy = "error"
+)
+
+func parseFileMergeStrategy(s string) (fileMergeStrategy, error) {
+	switch fileMergeStrategy(s) {
+	case mergeOverride, mergeAppend, mergeError:
+		return fileMergeStrategy(s), nil
+	default:
+		return "", fmt.Errorf("unknown -strategy %q (want override, append, or error)", s)
+	}
+}
+
+// fileEntry pairs a flattened input with the path it came from, so conflict
+// reports and diffs can name the offending files.
+type fileEntry struct {
+	Path string
+	Data map[string]interface{}
+}
+
+// sortedKeysForMerge orders a file's flat keys for merging: plain
+// sortedKeys' lexicographic order sorts "foo[10]" before "foo[2]", which
+// would scramble -strategy=append's renumbering for any array of 10+
+// elements, so array-suffixed keys sharing a base are instead ordered by
+// their numeric index. Keys that aren't both array-suffixed with the same
+// base still fall back to lexicographic order.
+func sortedKeysForMerge(m map[string]interface{}) []string {
+	keys := sortedKeys(m)
+	sort.SliceStable(keys, func(i, j int) bool {
+		baseI, idxI, isArrayI := parseArrayKey(keys[i])
+		baseJ, idxJ, isArrayJ := parseArrayKey(keys[j])
+		if isArrayI && isArrayJ && baseI == baseJ {
+			return idxI < idxJ
+		}
+		return keys[i] < keys[j]
+	})
+	return keys
+}
+
+// mergeFileEntries combines the flattened data of every input file into one
+// map. Under "override" the last file to set a key wins, matching the
+// tool's original behavior. Under "append", array-suffixed keys (foo[0],
+// foo[1], ...) are renumbered to continue the array instead of overwriting
+// it, while scalar keys still override. Under "error", every conflicting
+// key is collected and reported together, naming both source files and
+// values, instead of failing on the first one found.
+func mergeFileEntries(entries []fileEntry, strategy fileMergeStrategy) (map[string]interface{}, map[string]string, error) {
+	merged := make(map[string]interface{})
+	source := make(map[string]string)
+	arrayNextIndex := make(map[string]int)
+	var conflicts []string
+
+	for _, entry := range entries {
+		for _, k := range sortedKeysForMerge(entry.Data) {
+			v := entry.Data[k]
+
+			if strategy == mergeAppend {
+				if base, _, isArray := parseArrayKey(k); isArray {
+					newKey := fmt.Sprintf("%s[%d]", base, arrayNextIndex[base])
+					arrayNextIndex[base]++
+					merged[newKey] = v
+					source[newKey] = entry.Path
+					continue
+				}
+			}
+
+			existing, seen := merged[k]
+			if !seen {
+				merged[k] = v
+				source[k] = entry.Path
+				continue
+			}
+
+			switch strategy {
+			case mergeOverride, mergeAppend:
+				merged[k] = v
+				source[k] = entry.Path
+			case mergeError:
+				if fmt.Sprintf("%v", existing) != fmt.Sprintf("%v", v) {
+					conflicts = append(conflicts, fmt.Sprintf("%s: %s=%v vs %s=%v", k, source[k], existing, entry.Path, v))
+				}
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, nil, fmt.Errorf("conflicting keys across inputs:\n  %s", strings.Join(conflicts, "\n  "))
+	}
+	return merged, source, nil
+}
+
+// printMergeDiff reports, for -dry-run -diff, which input file each key in
+// the final merge came from, and which of a file's own keys were overridden
+// by a later input.
+func printMergeDiff(entries []fileEntry, merged map[string]interface{}, source map[string]string) {
+	for _, entry := range entries {
+		fmt.Printf("%s:\n", entry.Path)
+		for _, k := range sortedKeysForMerge(entry.Data) {
+			if source[k] == entry.Path {
+				fmt.Printf("  + %s = %v\n", k, merged[k])
+			} else {
+				fmt.Printf("  ~ %s = %v (overridden by %s)\n", k, entry.Data[k], source[k])
+			}
+		}
+	}
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// docMergeStrategy controls how multiple YAML documents in a single
+// `---`-separated stream are combined into one flat map.
+type docMergeStrategy string
+
+const (
+	mergeLastWins   docMergeStrategy = "last-wins"
+	mergeFirstWins  docMergeStrategy = "first-wins"
+	mergeOnConflict docMergeStrategy = "error-on-conflict"
+)
+
+func parseDocMergeStrategy(s string) (docMergeStrategy, error) {
+	switch docMergeStrategy(s) {
+	case mergeLastWins, mergeFirstWins, mergeOnConflict:
+		return docMergeStrategy(s), nil
+	default:
+		return "", fmt.Errorf("unknown -merge strategy %q (want last-wins, first-wins, or error-on-conflict)", s)
+	}
+}
+
+// parseYAMLDocumentsFromContent decodes every document in a
+// `---`-separated YAML stream, instead of silently keeping only the first
+// one. Each document is returned as its own map, unflattened, so callers
+// can flatten or merge however they need.
+func parseYAMLDocumentsFromContent(content string) ([]map[string]interface{}, error) {
+	dec := yaml.NewDecoder(strings.NewReader(content))
+	var docs []map[string]interface{}
+	for {
+		var doc map[string]interface{}
+		if err := dec.Decode(&doc); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return nil, err
+		}
+		if doc == nil {
+			continue
+		}
+		docs = append(docs, doc)
+	}
+	return docs, nil
+}
+
+// flattenDocs flattens each document independently, preserving document
+// order so per-document output and merge strategies both have something
+// sane to work with.
+func flattenDocs(docs []map[string]interface{}, quoteKeys bool) []map[string]interface{} {
+	flat := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		flat[i] = make(map[string]interface{})
+		flatten("", doc, flat[i], quoteKeys)
+	}
+	return flat
+}
+
+// mergeFlatDocs combines the flattened documents of one YAML stream into a
+// single flat map according to strategy. error-on-conflict reports every
+// key that two documents disagree on, not just the first.
+func mergeFlatDocs(docs []map[string]interface{}, strategy docMergeStrategy) (map[string]interface{}, error) {
+	merged := make(map[string]interface{})
+	var conflicts []string
+
+	for _, doc := range docs {
+		for k, v := range doc {
+			existing, seen := merged[k]
+			if !seen {
+				merged[k] = v
+				continue
+			}
+			switch strategy {
+			case mergeLastWins:
+				merged[k] = v
+			case mergeFirstWins:
+				// keep existing
+			case mergeOnConflict:
+				if fmt.Sprintf("%v", existing) != fmt.Sprintf("%v", v) {
+					conflicts = append(conflicts, fmt.Sprintf("%s (%v vs %v)", k, existing, v))
+				}
+			}
+		}
+	}
+
+	if len(conflicts) > 0 {
+		return nil, fmt.Errorf("conflicting keys across documents: %s", strings.Join(conflicts, "; "))
+	}
+	return merged, nil
+}
+
+// outputHasDocPlaceholder reports whether output is a per-document output
+// template, i.e. contains {index} or {doc}.
+func outputHasDocPlaceholder(output string) bool {
+	return strings.Contains(output, "{index}") || strings.Contains(output, "{doc}")
+}
+
+func renderDocOutputPath(output string, index int) string {
+	replacer := strings.NewReplacer(
+		"{index}", strconv.Itoa(index),
+		"{doc}", strconv.Itoa(index),
+	)
+	return replacer.Replace(output)
+}
+
+// writeYAMLDocuments writes each doc as its own YAML document in a single
+// `---`-separated stream, the multi-doc mirror of writeYAML.
+func writeYAMLDocuments(docs []map[string]interface{}, path string) error {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			enc.Close()
+			return err
+		}
+	}
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return writeOutput(path, buf.Bytes())
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"vaultboy/internal/query"
+)
+
+// queryFlags bundles the -select/-set/-delete flags into the three
+// transforms applied to a flattened map before it's written out, in both
+// normal and reverse mode.
+type queryFlags struct {
+	Select []string
+	Set    []string
+	Delete []string
+}
+
+func (q queryFlags) apply(data map[string]interface{}) (map[string]interface{}, error) {
+	if len(q.Select) > 0 {
+		data = query.Select(data, q.Select)
+	}
+	for _, kv := range q.Set {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid -set %q, expected key=value", kv)
+		}
+		data = query.Set(data, parts[0], parts[1])
+	}
+	if len(q.Delete) > 0 {
+		data = query.Delete(data, q.Delete)
+	}
+	return data, nil
+}
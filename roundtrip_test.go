@@ -0,0 +1,160 @@
+package main
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+)
+
+// genValue produces a random JSON-ish leaf value: the same set of types
+// encoding/json produces when unmarshaling into interface{}, so a
+// generated tree looks like real parsed input.
+func genValue(rng *rand.Rand) interface{} {
+	switch rng.Intn(4) {
+	case 0:
+		return rng.Float64()*200 - 100
+	case 1:
+		return rng.Intn(2) == 0
+	case 2:
+		words := []string{"alpha", "bravo", "charlie", "delta", "echo"}
+		return words[rng.Intn(len(words))]
+	default:
+		return nil
+	}
+}
+
+// genMap builds a random nested map/array tree up to maxDepth deep, using
+// plain alphanumeric key names so it round-trips with or without
+// -quote-keys. Arrays are always built contiguous from index 0, but may
+// still contain a real nil element (genValue's default case): flatten
+// writes that index's key with a nil value, so unflatten sees an explicit
+// write there and arrayGapSentinel never survives to distinguish it from
+// an unfilled gap (see validateNoArrayGaps in typed.go).
+func genMap(rng *rand.Rand, maxDepth int) map[string]interface{} {
+	keys := []string{"foo", "bar", "baz", "qux", "quux"}
+	out := make(map[string]interface{})
+	n := 1 + rng.Intn(len(keys))
+	for i := 0; i < n; i++ {
+		key := keys[i]
+		switch {
+		case maxDepth > 0 && rng.Intn(3) == 0:
+			out[key] = genMap(rng, maxDepth-1)
+		case rng.Intn(3) == 0:
+			arr := make([]interface{}, 1+rng.Intn(3))
+			for j := range arr {
+				if maxDepth > 0 && rng.Intn(2) == 0 {
+					arr[j] = genMap(rng, maxDepth-1)
+				} else {
+					arr[j] = genValue(rng)
+				}
+			}
+			out[key] = arr
+		default:
+			out[key] = genValue(rng)
+		}
+	}
+	return out
+}
+
+// TestFlattenUnflattenRoundTrip fuzzes a corpus of random nested
+// map/array trees and checks flatten/unflatten recover the original
+// structure, since every writer in this tool (writeFlatOutput, runReverse,
+// runVaultPull) depends on that round-trip being lossless.
+func TestFlattenUnflattenRoundTrip(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		original := genMap(rng, 3)
+
+		flat := make(map[string]interface{})
+		flatten("", original, flat, false)
+
+		rebuilt, err := unflatten(flat, unflattenOptions{})
+		if err != nil {
+			t.Fatalf("case %d: unflatten: %v", i, err)
+		}
+
+		if !reflect.DeepEqual(original, rebuilt) {
+			t.Fatalf("case %d: round-trip mismatch\noriginal: %#v\nrebuilt:  %#v", i, original, rebuilt)
+		}
+	}
+}
+
+// TestFlattenUnflattenQuoteKeysRoundTrip checks that a raw key containing
+// the flat-key grammar's own separators survives flatten/unflatten when
+// -quote-keys is on.
+func TestFlattenUnflattenQuoteKeysRoundTrip(t *testing.T) {
+	original := map[string]interface{}{
+		"a.b":    "dotted",
+		"c[0]d":  "bracketed",
+		"bar[0]": "trailing bracket, not an array index",
+		`e"f`:    "quoted",
+		"normal": "unaffected",
+	}
+
+	flat := make(map[string]interface{})
+	flatten("", original, flat, true)
+
+	rebuilt, err := unflatten(flat, unflattenOptions{QuoteKeys: true})
+	if err != nil {
+		t.Fatalf("unflatten: %v", err)
+	}
+	if !reflect.DeepEqual(original, rebuilt) {
+		t.Fatalf("round-trip mismatch\noriginal: %#v\nrebuilt:  %#v", original, rebuilt)
+	}
+}
+
+// TestUnflattenRejectsArrayGaps checks that a flat map describing a
+// non-contiguous array errors unless -allow-sparse is set.
+func TestUnflattenRejectsArrayGaps(t *testing.T) {
+	flat := map[string]interface{}{
+		"items[0]": "a",
+		"items[2]": "c",
+	}
+
+	if _, err := unflatten(flat, unflattenOptions{}); err == nil {
+		t.Fatal("expected an error for a non-contiguous array, got nil")
+	}
+
+	rebuilt, err := unflatten(flat, unflattenOptions{AllowSparse: true})
+	if err != nil {
+		t.Fatalf("unflatten with -allow-sparse: %v", err)
+	}
+	items, ok := rebuilt["items"].([]interface{})
+	if !ok || len(items) != 3 || items[1] != nil {
+		t.Fatalf("expected a 3-element array with a nil hole at index 1, got %#v", rebuilt["items"])
+	}
+}
+
+// TestUnflattenAllowsExplicitNullArrayElement checks that a contiguous
+// array with a real null element isn't mistaken for a gap: unlike a
+// missing index, it's a key in the flat map whose value is nil.
+func TestUnflattenAllowsExplicitNullArrayElement(t *testing.T) {
+	flat := map[string]interface{}{
+		"items[0]": nil,
+		"items[1]": "foo",
+	}
+
+	rebuilt, err := unflatten(flat, unflattenOptions{})
+	if err != nil {
+		t.Fatalf("unflatten: %v", err)
+	}
+	items, ok := rebuilt["items"].([]interface{})
+	if !ok || len(items) != 2 || items[0] != nil || items[1] != "foo" {
+		t.Fatalf("expected [nil, \"foo\"], got %#v", rebuilt["items"])
+	}
+}
+
+// TestInferValuePreservesLeadingZeros checks that -typed doesn't mangle a
+// numeric-looking identifier like a zip code or PIN by inferring it as an
+// int and dropping its leading zeros.
+func TestInferValuePreservesLeadingZeros(t *testing.T) {
+	if got := inferValue("00042"); got != "00042" {
+		t.Fatalf("inferValue(%q) = %#v, want the original string", "00042", got)
+	}
+	if got := inferValue("0"); got != int64(0) {
+		t.Fatalf("inferValue(%q) = %#v, want int64(0)", "0", got)
+	}
+	if got := inferValue("42"); got != int64(42) {
+		t.Fatalf("inferValue(%q) = %#v, want int64(42)", "42", got)
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// templateContext is the data made available to input files before they're
+// parsed: {{.Vars.foo}} for user-supplied variables (from -vars/-var) and
+// {{.Env.HOME}} for the process environment.
+type templateContext struct {
+	Vars map[string]interface{}
+	Env  map[string]string
+}
+
+func newTemplateContext(varsFile string, inlineVars []string) (templateContext, error) {
+	ctx := templateContext{
+		Vars: make(map[string]interface{}),
+		Env:  envMap(),
+	}
+
+	if varsFile != "" {
+		parsed, err := detectAndParse(varsFile, templateContext{}, mergeLastWins, parseOptions{})
+		if err != nil {
+			return ctx, fmt.Errorf("failed to parse -vars file %s: %w", varsFile, err)
+		}
+		for k, v := range parsed {
+			ctx.Vars[k] = v
+		}
+	}
+
+	for _, kv := range inlineVars {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) != 2 {
+			return ctx, fmt.Errorf("invalid -var %q, expected key=value", kv)
+		}
+		ctx.Vars[parts[0]] = parts[1]
+	}
+
+	return ctx, nil
+}
+
+func envMap() map[string]string {
+	out := make(map[string]string)
+	for _, kv := range os.Environ() {
+		parts := strings.SplitN(kv, "=", 2)
+		if len(parts) == 2 {
+			out[parts[0]] = parts[1]
+		}
+	}
+	return out
+}
+
+// isEmpty reports whether a template value should be treated as "unset" by
+// default/required, covering the zero values text/template hands back for
+// missing map keys and explicit nils/empty strings.
+func isEmpty(v interface{}) bool {
+	if v == nil {
+		return true
+	}
+	if s, ok := v.(string); ok {
+		return s == ""
+	}
+	return false
+}
+
+func templateFuncs(missing *[]string) template.FuncMap {
+	return template.FuncMap{
+		"default": func(def interface{}, v interface{}) interface{} {
+			if isEmpty(v) {
+				return def
+			}
+			return v
+		},
+		"required": func(name string, v interface{}) (interface{}, error) {
+			if isEmpty(v) {
+				*missing = append(*missing, name)
+				return nil, fmt.Errorf("required value %q is missing", name)
+			}
+			return v, nil
+		},
+		"toJson": func(v interface{}) (string, error) {
+			b, err := json.Marshal(v)
+			if err != nil {
+				return "", err
+			}
+			return string(b), nil
+		},
+	}
+}
+
+// renderTemplate renders raw as a text/template named path using ctx,
+// before any .env/.yaml parsing happens. A template referencing
+// {{required "foo" ...}} with foo missing aborts with an error naming the
+// missing key, rather than producing a file with a literal "<no value>" in
+// it.
+func renderTemplate(path, raw string, ctx templateContext) (string, error) {
+	var missing []string
+	tmpl, err := template.New(path).Option("missingkey=zero").Funcs(templateFuncs(&missing)).Parse(raw)
+	if err != nil {
+		return "", fmt.Errorf("parse template %s: %w", path, err)
+	}
+
+	var buf bytes.Buffer
+	if err := tmpl.Execute(&buf, ctx); err != nil {
+		if len(missing) > 0 {
+			return "", fmt.Errorf("render template %s: missing required value(s): %s", path, strings.Join(missing, ", "))
+		}
+		return "", fmt.Errorf("render template %s: %w", path, err)
+	}
+
+	return buf.String(), nil
+}
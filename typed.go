@@ -0,0 +1,199 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// inferValue converts a raw .env string value into a bool/int64/float64, or
+// nil for an empty string, under -typed. Anything that doesn't parse as one
+// of those is left as a string.
+func inferValue(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	// strconv.ParseBool also accepts the single-character forms "1"/"0"/
+	// "t"/"f", which would otherwise steal digit strings like "0" away
+	// from the int branch below; restrict inference to the unambiguous
+	// "true"/"false" spellings.
+	if strings.EqualFold(s, "true") {
+		return true
+	}
+	if strings.EqualFold(s, "false") {
+		return false
+	}
+	// A leading zero (other than "0" itself) means the string is an
+	// identifier like a zip code or PIN, not a number: inferring it away
+	// would silently drop the leading zeros. This guards both numeric
+	// branches, since ParseFloat would otherwise happily turn "00042"
+	// into 42 right after the int branch declines it.
+	if s == "0" || !strings.HasPrefix(s, "0") {
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	}
+	return s
+}
+
+// applyTypedInference runs inferValue over every string value in data,
+// for -typed.
+func applyTypedInference(data map[string]interface{}) map[string]interface{} {
+	result := make(map[string]interface{}, len(data))
+	for k, v := range data {
+		if s, ok := v.(string); ok {
+			result[k] = inferValue(s)
+		} else {
+			result[k] = v
+		}
+	}
+	return result
+}
+
+// keyNeedsQuoting reports whether a raw map key must be quoted under
+// -quote-keys to survive a flatten/unflatten round-trip, because it
+// contains a character the flat-key grammar itself uses as a separator.
+func keyNeedsQuoting(key string) bool {
+	return strings.ContainsAny(key, `.[]"`)
+}
+
+// quoteKeySegment escapes key for the `foo."bar.baz"[0]` quoted-key syntax.
+func quoteKeySegment(key string) string {
+	return `"` + strings.ReplaceAll(key, `"`, `\"`) + `"`
+}
+
+// flatKeySegment is one dot-separated part of a flat key, as split out by
+// splitFlatKey. Quoted is set for a `"..."`-quoted segment, whose Name is
+// already fully resolved (dequoted, with any trailing "[N]" outside the
+// quotes already parsed into Index) and must not be re-parsed for array
+// syntax by parseArrayKey a second time — otherwise a literal key ending
+// in brackets (e.g. "bar[0]") would be corrupted into an array.
+type flatKeySegment struct {
+	Name     string
+	Index    int
+	HasIndex bool
+	Quoted   bool
+}
+
+// splitFlatKey splits a flat key into its dot-separated segments. When
+// quoteKeys is true, a `"..."`-quoted segment (with \" escapes) is treated
+// as a single segment even if it contains literal dots or brackets, so
+// `foo."bar.baz"[0]` round-trips instead of being split on every dot.
+func splitFlatKey(key string, quoteKeys bool) []flatKeySegment {
+	if !quoteKeys || !strings.Contains(key, `"`) {
+		parts := strings.Split(key, ".")
+		segs := make([]flatKeySegment, len(parts))
+		for i, p := range parts {
+			segs[i] = flatKeySegment{Name: p}
+		}
+		return segs
+	}
+
+	var segs []flatKeySegment
+	i := 0
+	for i < len(key) {
+		if key[i] == '"' {
+			var sb strings.Builder
+			j := i + 1
+			for j < len(key) && key[j] != '"' {
+				if key[j] == '\\' && j+1 < len(key) && key[j+1] == '"' {
+					sb.WriteByte('"')
+					j += 2
+					continue
+				}
+				sb.WriteByte(key[j])
+				j++
+			}
+			j++ // skip closing quote
+
+			seg := flatKeySegment{Name: sb.String(), Quoted: true}
+			if j < len(key) && key[j] == '[' {
+				if end := strings.IndexByte(key[j:], ']'); end != -1 {
+					if idx, err := strconv.Atoi(key[j+1 : j+end]); err == nil {
+						seg.Index = idx
+						seg.HasIndex = true
+					}
+					j += end + 1
+				}
+			}
+			segs = append(segs, seg)
+
+			if j < len(key) && key[j] == '.' {
+				j++
+			}
+			i = j
+			continue
+		}
+
+		if dot := strings.IndexByte(key[i:], '.'); dot != -1 {
+			segs = append(segs, flatKeySegment{Name: key[i : i+dot]})
+			i += dot + 1
+		} else {
+			segs = append(segs, flatKeySegment{Name: key[i:]})
+			i = len(key)
+		}
+	}
+	return segs
+}
+
+// arrayGapSentinel marks a slice slot that unflatten grew to size an array
+// but that no flat key ever explicitly assigned. It's a distinct value
+// from a real nil so a hole can be told apart from an explicit null array
+// element (e.g. `items: [null, "b"]` in YAML/JSON, or a -typed .env value
+// that inferred to nil) — both of which end up as a plain Go nil in the
+// slice once a value is actually written.
+var arrayGapSentinel = new(struct{})
+
+// validateNoArrayGaps walks an unflattened structure and errors on the
+// first array hole it finds, since unflatten marks an index it only grew
+// the array to reach (and never received an explicit write) with
+// arrayGapSentinel — a hole there means the input had non-contiguous
+// indices, unless -allow-sparse opted in.
+func validateNoArrayGaps(node interface{}, path string) error {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for k, val := range v {
+			childPath := k
+			if path != "" {
+				childPath = path + "." + k
+			}
+			if err := validateNoArrayGaps(val, childPath); err != nil {
+				return err
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			if item == arrayGapSentinel {
+				return fmt.Errorf("array %q has a gap at index %d (pass -allow-sparse to permit holes)", path, i)
+			}
+			if err := validateNoArrayGaps(item, fmt.Sprintf("%s[%d]", path, i)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// fillArrayGaps replaces any remaining arrayGapSentinel left by unflatten
+// (an -allow-sparse hole that validateNoArrayGaps was never asked to
+// reject) with a real nil, so the sentinel never leaks into the returned
+// structure.
+func fillArrayGaps(node interface{}) {
+	switch v := node.(type) {
+	case map[string]interface{}:
+		for _, val := range v {
+			fillArrayGaps(val)
+		}
+	case []interface{}:
+		for i, item := range v {
+			if item == arrayGapSentinel {
+				v[i] = nil
+				continue
+			}
+			fillArrayGaps(item)
+		}
+	}
+}
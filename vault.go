@@ -0,0 +1,242 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// vaultConfig holds the connection details needed to talk to a Vault KV v2
+// mount. Addr and Token fall back to the VAULT_ADDR/VAULT_TOKEN env vars
+// when the matching flag is left empty, matching the vault CLI's own
+// precedence (flag wins over env).
+type vaultConfig struct {
+	Addr      string
+	Token     string
+	Namespace string
+	Path      string
+	CAS       int
+	BatchSize int
+}
+
+// vaultClient is a minimal HTTP client for the Vault KV v2 secrets engine.
+// It only implements the two calls vaultboy needs: read and write a secret
+// version, both under the "data" subpath KV v2 expects.
+type vaultClient struct {
+	addr       string
+	token      string
+	namespace  string
+	httpClient *http.Client
+}
+
+func newVaultClient(cfg vaultConfig) *vaultClient {
+	return &vaultClient{
+		addr:      strings.TrimRight(cfg.Addr, "/"),
+		token:     cfg.Token,
+		namespace: cfg.Namespace,
+		httpClient: &http.Client{
+			Timeout: 30 * time.Second,
+		},
+	}
+}
+
+func (c *vaultClient) newRequest(method, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", c.token)
+	if c.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", c.namespace)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// kv2ReadResponse mirrors the subset of Vault's KV v2 read response we care
+// about: the secret data and the version metadata needed for CAS writes.
+type kv2ReadResponse struct {
+	Data struct {
+		Data     map[string]interface{} `json:"data"`
+		Metadata struct {
+			Version int `json:"version"`
+		} `json:"metadata"`
+	} `json:"data"`
+}
+
+// readSecret fetches the current value and version of a KV v2 secret.
+// A 404 is not treated as an error: it simply means the secret doesn't
+// exist yet, so CAS writes should use version 0.
+func (c *vaultClient) readSecret(path string) (map[string]interface{}, int, error) {
+	url := fmt.Sprintf("%s/v1/%s/data/%s", c.addr, kv2Mount(path), kv2Subpath(path))
+	req, err := c.newRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return nil, 0, fmt.Errorf("vault read %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, 0, nil
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := io.ReadAll(resp.Body)
+		return nil, 0, fmt.Errorf("vault read %s: unexpected status %d: %s", path, resp.StatusCode, body)
+	}
+
+	var parsed kv2ReadResponse
+	if err := json.NewDecoder(resp.Body).Decode(&parsed); err != nil {
+		return nil, 0, fmt.Errorf("vault read %s: decode response: %w", path, err)
+	}
+	return parsed.Data.Data, parsed.Data.Metadata.Version, nil
+}
+
+// writeSecret writes data to a KV v2 path. When cas is non-negative it is
+// sent as the check-and-set version, so the write fails if the secret has
+// moved on since it was last read — this is what stops a stale local file
+// from silently clobbering newer secrets in Vault.
+func (c *vaultClient) writeSecret(path string, data map[string]interface{}, cas int) error {
+	payload := map[string]interface{}{"data": data}
+	if cas >= 0 {
+		payload["options"] = map[string]interface{}{"cas": cas}
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("vault write %s: marshal payload: %w", path, err)
+	}
+
+	url := fmt.Sprintf("%s/v1/%s/data/%s", c.addr, kv2Mount(path), kv2Subpath(path))
+	req, err := c.newRequest(http.MethodPut, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+
+	resp, err := c.httpClient.Do(req)
+	if err != nil {
+		return fmt.Errorf("vault write %s: %w", path, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		respBody, _ := io.ReadAll(resp.Body)
+		if resp.StatusCode == http.StatusBadRequest && bytes.Contains(respBody, []byte("check-and-set")) {
+			return fmt.Errorf("vault write %s: CAS mismatch, secret was modified since last read: %s", path, respBody)
+		}
+		return fmt.Errorf("vault write %s: unexpected status %d: %s", path, resp.StatusCode, respBody)
+	}
+	return nil
+}
+
+// kv2Mount and kv2Subpath split a "mount/sub/path" into the mount name and
+// the remainder, assuming the first path segment is the KV v2 mount. This
+// matches how `vault kv put <mount>/<path>` is addressed.
+func kv2Mount(path string) string {
+	parts := strings.SplitN(strings.Trim(path, "/"), "/", 2)
+	return parts[0]
+}
+
+func kv2Subpath(path string) string {
+	parts := strings.SplitN(strings.Trim(path, "/"), "/", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return parts[1]
+}
+
+// runVaultPush flattens the given inputs, applies qf's -select/-set/-delete
+// projection, and pushes the result to a Vault KV v2 path, batching the
+// write in chunks of cfg.BatchSize keys so a very large flattened map
+// doesn't end up in a single oversized request. Each batch is applied as a
+// read-modify-write guarded by CAS so a write that races with another
+// writer fails loudly instead of overwriting it.
+func runVaultPush(inputs []string, cfg vaultConfig, ctx templateContext, qf queryFlags, parseOpts parseOptions) error {
+	entries := make([]fileEntry, 0, len(inputs))
+	for _, path := range inputs {
+		parsed, err := detectAndParse(path, ctx, mergeLastWins, parseOpts)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		entries = append(entries, fileEntry{Path: path, Data: parsed})
+	}
+
+	flat, _, err := mergeFileEntries(entries, mergeOverride)
+	if err != nil {
+		return err
+	}
+
+	flat, err = qf.apply(flat)
+	if err != nil {
+		return err
+	}
+
+	client := newVaultClient(cfg)
+	keys := sortedKeys(flat)
+	for i := 0; i < len(keys); i += cfg.BatchSize {
+		end := i + cfg.BatchSize
+		if end > len(keys) {
+			end = len(keys)
+		}
+
+		existing, version, err := client.readSecret(cfg.Path)
+		if err != nil {
+			return err
+		}
+		if existing == nil {
+			existing = make(map[string]interface{})
+		}
+		for _, k := range keys[i:end] {
+			existing[k] = flat[k]
+		}
+
+		cas := version
+		if cfg.CAS >= 0 {
+			cas = cfg.CAS
+		}
+		if err := client.writeSecret(cfg.Path, existing, cas); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runVaultPull fetches a secret from Vault, applies qf's -select/-set/
+// -delete projection, and renders it as .env or .yaml at outputPath,
+// inferring the format from the output extension the same way runReverse
+// does for a local JSON file.
+func runVaultPull(cfg vaultConfig, outputPath string, qf queryFlags, unflattenOpts unflattenOptions) error {
+	client := newVaultClient(cfg)
+	data, _, err := client.readSecret(cfg.Path)
+	if err != nil {
+		return err
+	}
+	if data == nil {
+		return fmt.Errorf("vault path %s has no secret", cfg.Path)
+	}
+
+	data, err = qf.apply(data)
+	if err != nil {
+		return err
+	}
+
+	switch strings.ToLower(filepath.Ext(outputPath)) {
+	case ".env":
+		return writeEnv(data, outputPath)
+	case ".yaml", ".yml":
+		nested, err := unflatten(data, unflattenOpts)
+		if err != nil {
+			return err
+		}
+		return writeYAML(nested, outputPath)
+	default:
+		return fmt.Errorf("unsupported output extension: %s", outputPath)
+	}
+}
@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"bytes"
 	"encoding/json"
 	"errors"
 	"flag"
@@ -21,9 +22,97 @@ func main() {
 	output := flag.String("o", "output.json", "Output file (.json, .env, .yaml)")
 	reverse := flag.Bool("reverse", false, "Reverse mode: Vault JSON to .env/.yaml")
 
+	vaultAddr := flag.String("vault-addr", os.Getenv("VAULT_ADDR"), "Vault address, e.g. https://vault.example.com:8200 (default: $VAULT_ADDR)")
+	vaultToken := flag.String("vault-token", os.Getenv("VAULT_TOKEN"), "Vault token (default: $VAULT_TOKEN)")
+	vaultNamespace := flag.String("vault-namespace", os.Getenv("VAULT_NAMESPACE"), "Vault Enterprise namespace (default: $VAULT_NAMESPACE)")
+	vaultPath := flag.String("vault-path", "", "KV v2 secret path to push to or pull from, e.g. secret/myapp")
+	vaultCAS := flag.Int("vault-cas", -1, "Check-and-set version to require on write (default: current version, i.e. safe overwrite)")
+	vaultBatchSize := flag.Int("vault-batch-size", 100, "Max number of keys written to Vault per request")
+
+	varsFile := flag.String("vars", "", "File of template variables (.env/.yaml) exposed to inputs as {{.Vars.foo}}")
+	var inlineVars multiFlag
+	flag.Var(&inlineVars, "var", "Inline template variable key=value (repeatable), exposed as {{.Vars.key}}")
+
+	merge := flag.String("merge", string(mergeLastWins), "How to combine multiple YAML documents in one file: last-wins, first-wins, or error-on-conflict")
+
+	strategy := flag.String("strategy", string(mergeOverride), "How to combine keys across multiple -i inputs: override, append, or error")
+	dryRun := flag.Bool("dry-run", false, "Compute the merge without writing the output file")
+	diff := flag.Bool("diff", false, "Show which keys each -i input contributed to the merge (implies -dry-run)")
+
+	format := flag.String("format", "", "Output format when -o is - or has no recognizable extension: json, yaml, or env")
+
+	typed := flag.Bool("typed", false, "Infer bool/int/float/null for .env values instead of keeping them as strings")
+	quoteKeys := flag.Bool("quote-keys", false, `Allow a quoted key segment (foo."bar.baz"[0]) to preserve literal dots/brackets in a raw key through flatten/unflatten`)
+	allowSparse := flag.Bool("allow-sparse", false, "Allow unflatten to fill non-contiguous array indices with null instead of erroring")
+
+	var qf queryFlags
+	flag.Var((*multiFlag)(&qf.Select), "select", "Select flattened keys matching a path pattern (foo.bar[0], services.*.host); repeatable, prefix with ! to exclude")
+	flag.Var((*multiFlag)(&qf.Set), "set", "Set a flattened key to a literal value: key=value (repeatable)")
+	flag.Var((*multiFlag)(&qf.Delete), "delete", "Delete flattened keys matching a path pattern (repeatable)")
+
 	flag.Var(&inputFiles, "i", "Input file(s): .env/.yaml or Vault .json")
 	flag.Parse()
 
+	templateCtx, err := newTemplateContext(*varsFile, inlineVars)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	mergeStrategy, err := parseDocMergeStrategy(*merge)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	fileStrategy, err := parseFileMergeStrategy(*strategy)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	var explicitFormat storeFormat
+	if *format != "" {
+		explicitFormat, err = parseStoreFormat(*format)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
+
+	parseOpts := parseOptions{Typed: *typed, QuoteKeys: *quoteKeys}
+	unflattenOpts := unflattenOptions{QuoteKeys: *quoteKeys, AllowSparse: *allowSparse}
+
+	if *vaultPath != "" {
+		cfg := vaultConfig{
+			Addr:      *vaultAddr,
+			Token:     *vaultToken,
+			Namespace: *vaultNamespace,
+			Path:      *vaultPath,
+			CAS:       *vaultCAS,
+			BatchSize: *vaultBatchSize,
+		}
+		if cfg.Addr == "" || cfg.Token == "" {
+			log.Fatal("❌ -vault-addr and -vault-token (or VAULT_ADDR/VAULT_TOKEN) are required with -vault-path")
+		}
+		if cfg.BatchSize <= 0 {
+			log.Fatalf("❌ -vault-batch-size must be greater than 0, got %d", cfg.BatchSize)
+		}
+
+		if *reverse {
+			if err := runVaultPull(cfg, *output, qf, unflattenOpts); err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+		} else {
+			if len(inputFiles) == 0 {
+				log.Fatal("❌ At least one input file is required using -i")
+			}
+			if err := runVaultPush(inputFiles, cfg, templateCtx, qf, parseOpts); err != nil {
+				log.Fatalf("❌ %v", err)
+			}
+			fmt.Printf("✅ Done! Pushed %d input(s) to %s\n", len(inputFiles), cfg.Path)
+			return
+		}
+		fmt.Printf("✅ Done! Output written to %s\n", *output)
+		return
+	}
+
 	if len(inputFiles) == 0 {
 		log.Fatal("❌ At least one input file is required using -i")
 	}
@@ -32,52 +121,173 @@ func main() {
 		if len(inputFiles) != 1 {
 			log.Fatal("❌ Reverse mode only accepts 1 input JSON file")
 		}
-		runReverse(inputFiles[0], *output)
+		revFormat := storeFormatFromExt(*output)
+		if revFormat == formatUnknown {
+			revFormat = explicitFormat
+		}
+		if revFormat != formatEnv && revFormat != formatYAML {
+			log.Fatalf("❌ Unsupported output for reverse mode: %s (use -format=env or -format=yaml)", *output)
+		}
+		runReverse(inputFiles[0], *output, revFormat, qf, unflattenOpts)
 	} else {
-		runNormal(inputFiles, *output)
+		outFormat := explicitFormat
+		if outFormat == formatUnknown {
+			outFormat = formatJSON
+		}
+		runNormal(inputFiles, *output, templateCtx, mergeStrategy, fileStrategy, *dryRun || *diff, *diff, outFormat, qf, parseOpts, unflattenOpts)
+		if *dryRun || *diff {
+			return
+		}
 	}
 	fmt.Printf("✅ Done! Output written to %s\n", *output)
 }
 
-func runNormal(inputs []string, output string) {
-	flat := make(map[string]interface{})
+func runNormal(inputs []string, output string, ctx templateContext, docStrategy docMergeStrategy, fileStrategy fileMergeStrategy, dryRun, diff bool, outFormat storeFormat, qf queryFlags, parseOpts parseOptions, unflattenOpts unflattenOptions) {
+	if outputHasDocPlaceholder(output) {
+		runNormalPerDocument(inputs, output, ctx, parseOpts.QuoteKeys)
+		return
+	}
+
+	entries := make([]fileEntry, 0, len(inputs))
 	for _, path := range inputs {
-		parsed, err := detectAndParse(path)
+		parsed, err := detectAndParse(path, ctx, docStrategy, parseOpts)
 		if err != nil {
 			log.Fatalf("❌ Failed to parse %s: %v", path, err)
 		}
-		for k, v := range parsed {
-			flat[k] = v
-		}
+		entries = append(entries, fileEntry{Path: path, Data: parsed})
 	}
 
-	jsonData, err := json.MarshalIndent(flat, "", "  ")
+	flat, source, err := mergeFileEntries(entries, fileStrategy)
 	if err != nil {
-		log.Fatalf("❌ Failed to marshal JSON: %v", err)
+		log.Fatalf("❌ %v", err)
+	}
+
+	if diff {
+		printMergeDiff(entries, flat, source)
+	}
+	if dryRun {
+		return
 	}
-	if err := os.WriteFile(output, jsonData, 0644); err != nil {
+
+	flat, err = qf.apply(flat)
+	if err != nil {
+		log.Fatalf("❌ %v", err)
+	}
+
+	if err := writeFlatOutput(flat, output, outFormat, unflattenOpts); err != nil {
 		log.Fatalf("❌ Failed to write %s: %v", output, err)
 	}
 }
 
-func runReverse(inputPath, outputPath string) {
-	data, err := parseJSON(inputPath)
+// writeFlatOutput renders a flat map in the given format, defaulting to the
+// tool's original Vault JSON output. output may be "-" for stdout.
+func writeFlatOutput(flat map[string]interface{}, output string, format storeFormat, unflattenOpts unflattenOptions) error {
+	switch format {
+	case formatEnv:
+		return writeEnv(flat, output)
+	case formatYAML:
+		nested, err := unflatten(flat, unflattenOpts)
+		if err != nil {
+			return err
+		}
+		return writeYAML(nested, output)
+	default:
+		jsonData, err := json.MarshalIndent(flat, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		return writeOutput(output, jsonData)
+	}
+}
+
+// runNormalPerDocument emits one JSON file per YAML document instead of
+// merging them, for an -o template containing {index} or {doc}.
+func runNormalPerDocument(inputs []string, output string, ctx templateContext, quoteKeys bool) {
+	ext := ""
+	if len(inputs) == 1 {
+		ext = strings.ToLower(filepath.Ext(inputs[0]))
+	}
+	if len(inputs) != 1 || (ext != ".yaml" && ext != ".yml") {
+		log.Fatal("❌ Per-document output (-o with {index}/{doc}) requires exactly 1 .yaml input")
+	}
+
+	raw, err := readInputBytes(inputs[0])
 	if err != nil {
-		log.Fatalf("❌ Failed to read input JSON: %v", err)
+		log.Fatalf("❌ Failed to parse %s: %v", inputs[0], err)
+	}
+	content, err := renderedContent(inputs[0], string(raw), ctx, formatYAML)
+	if err != nil {
+		log.Fatalf("❌ Failed to parse %s: %v", inputs[0], err)
+	}
+	docs, err := parseYAMLDocumentsFromContent(content)
+	if err != nil {
+		log.Fatalf("❌ Failed to parse %s: %v", inputs[0], err)
+	}
+
+	for i, flat := range flattenDocs(docs, quoteKeys) {
+		jsonData, err := json.MarshalIndent(flat, "", "  ")
+		if err != nil {
+			log.Fatalf("❌ Failed to marshal document %d: %v", i, err)
+		}
+		path := renderDocOutputPath(output, i)
+		if err := os.WriteFile(path, jsonData, 0644); err != nil {
+			log.Fatalf("❌ Failed to write %s: %v", path, err)
+		}
 	}
+}
 
-	switch strings.ToLower(filepath.Ext(outputPath)) {
-	case ".env":
+// runReverse renders a Vault JSON input (inputPath may be "-" for stdin) as
+// .env or .yaml at outputPath (outputPath may be "-" for stdout). format is
+// resolved by the caller from outputPath's extension or, failing that, the
+// -format flag. qf's select/set/delete are applied to each document before
+// it's rendered.
+func runReverse(inputPath, outputPath string, format storeFormat, qf queryFlags, unflattenOpts unflattenOptions) {
+	if format == formatEnv {
+		data, err := parseJSON(inputPath)
+		if err != nil {
+			log.Fatalf("❌ Failed to read input JSON: %v", err)
+		}
+		data, err = qf.apply(data)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
 		if err := writeEnv(data, outputPath); err != nil {
 			log.Fatalf("❌ Failed to write env: %v", err)
 		}
-	case ".yaml", ".yml":
-		nested := unflatten(data)
+		return
+	}
+
+	docs, err := parseJSONDocuments(inputPath)
+	if err != nil {
+		log.Fatalf("❌ Failed to read input JSON: %v", err)
+	}
+	for i, doc := range docs {
+		docs[i], err = qf.apply(doc)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
+
+	if len(docs) == 1 {
+		nested, err := unflatten(docs[0], unflattenOpts)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
 		if err := writeYAML(nested, outputPath); err != nil {
 			log.Fatalf("❌ Failed to write yaml: %v", err)
 		}
-	default:
-		log.Fatalf("❌ Unsupported output extension: %s", outputPath)
+		return
+	}
+
+	nested := make([]map[string]interface{}, len(docs))
+	for i, doc := range docs {
+		nested[i], err = unflatten(doc, unflattenOpts)
+		if err != nil {
+			log.Fatalf("❌ %v", err)
+		}
+	}
+	if err := writeYAMLDocuments(nested, outputPath); err != nil {
+		log.Fatalf("❌ Failed to write yaml: %v", err)
 	}
 }
 
@@ -85,33 +295,84 @@ type multiFlag []string
 
 func (m *multiFlag) String() string         { return strings.Join(*m, ", ") }
 func (m *multiFlag) Set(value string) error { *m = append(*m, value); return nil }
-func detectAndParse(path string) (map[string]interface{}, error) {
-	ext := strings.ToLower(filepath.Ext(path))
-	switch ext {
-	case ".env":
-		return parseEnvFile(path)
-	case ".yaml", ".yml":
-		raw, err := parseYAML(path)
+
+// parseOptions are the -typed/-quote-keys flags that affect how an input is
+// flattened into a map (see typed.go).
+type parseOptions struct {
+	Typed     bool
+	QuoteKeys bool
+}
+
+// detectAndParse parses an input into a flat map. path may be "-" to read
+// from stdin. The format is taken from the file extension when recognized,
+// and otherwise content-sniffed (see format.go) so stdin, extension-less
+// files, and misnamed files all still work. For a .env/.yaml input, the
+// content is first rendered as a text/template (see template.go) so those
+// inputs can be shared across environments and filled in at flatten time;
+// JSON inputs are never templated, since a JSON value may legitimately
+// contain literal "{{"/"}}". A YAML input may be a `---`-separated stream
+// of several documents; they're flattened independently and then combined
+// into one map using strategy (see multidoc.go).
+func detectAndParse(path string, ctx templateContext, strategy docMergeStrategy, opts parseOptions) (map[string]interface{}, error) {
+	raw, err := readInputBytes(path)
+	if err != nil {
+		return nil, err
+	}
+
+	format := storeFormatFromExt(path)
+	if format == formatUnknown {
+		format = getStoreFormatFromData(raw)
+	}
+
+	content, err := renderedContent(path, string(raw), ctx, format)
+	if err != nil {
+		return nil, err
+	}
+
+	switch format {
+	case formatEnv:
+		result, err := parseEnvContent(content)
 		if err != nil {
 			return nil, err
 		}
+		if opts.Typed {
+			result = applyTypedInference(result)
+		}
+		return result, nil
+	case formatYAML:
+		docs, err := parseYAMLDocumentsFromContent(content)
+		if err != nil {
+			return nil, err
+		}
+		return mergeFlatDocs(flattenDocs(docs, opts.QuoteKeys), strategy)
+	case formatJSON:
+		var raw map[string]interface{}
+		if err := json.Unmarshal([]byte(content), &raw); err != nil {
+			return nil, err
+		}
 		flat := make(map[string]interface{})
-		flatten("", raw, flat)
+		flatten("", raw, flat, opts.QuoteKeys)
 		return flat, nil
 	default:
-		return nil, errors.New("unsupported input file type: " + ext)
+		return nil, errors.New("could not detect format of " + path)
 	}
 }
 
-func parseEnvFile(path string) (map[string]interface{}, error) {
-	f, err := os.Open(path)
-	if err != nil {
-		return nil, err
+// renderedContent runs raw through the template engine for .env/.yaml
+// inputs only. JSON inputs are passed through untouched: a JSON value can
+// legitimately contain literal "{{"/"}}" (a feature-flag payload, a Vault
+// export re-fed via -i, ...), and templating those would fail or mangle
+// them for no benefit, since JSON has no use for environment interpolation.
+func renderedContent(path string, raw string, ctx templateContext, format storeFormat) (string, error) {
+	if format != formatEnv && format != formatYAML {
+		return raw, nil
 	}
-	defer f.Close()
+	return renderTemplate(path, raw, ctx)
+}
 
+func parseEnvContent(content string) (map[string]interface{}, error) {
 	result := make(map[string]interface{})
-	scanner := bufio.NewScanner(f)
+	scanner := bufio.NewScanner(strings.NewReader(content))
 	for scanner.Scan() {
 		line := strings.TrimSpace(scanner.Text())
 		if line == "" || strings.HasPrefix(line, "#") {
@@ -128,32 +389,28 @@ func parseEnvFile(path string) (map[string]interface{}, error) {
 	return result, scanner.Err()
 }
 
-func parseYAML(path string) (map[string]interface{}, error) {
-	b, err := os.ReadFile(path)
-	if err != nil {
-		return nil, err
-	}
-	var out map[string]interface{}
-	if err := yaml.Unmarshal(b, &out); err != nil {
-		return nil, err
-	}
-	return out, nil
-}
-
-func flatten(prefix string, in map[string]interface{}, out map[string]interface{}) {
+// flatten walks in and writes its leaves into out under "foo.bar[0].baz"
+// style keys. When quoteKeys is true, a raw key containing a dot, bracket,
+// or quote is escaped as a `"..."` quoted segment (see typed.go) so it
+// survives being split back apart by unflatten.
+func flatten(prefix string, in map[string]interface{}, out map[string]interface{}, quoteKeys bool) {
 	for k, v := range in {
-		key := k
+		segment := k
+		if quoteKeys && keyNeedsQuoting(k) {
+			segment = quoteKeySegment(k)
+		}
+		key := segment
 		if prefix != "" {
-			key = prefix + "." + k
+			key = prefix + "." + segment
 		}
 		switch val := v.(type) {
 		case map[string]interface{}:
-			flatten(key, val, out)
+			flatten(key, val, out, quoteKeys)
 		case []interface{}:
 			for i, item := range val {
 				itemKey := fmt.Sprintf("%s[%d]", key, i)
 				if m, ok := item.(map[string]interface{}); ok {
-					flatten(itemKey, m, out)
+					flatten(itemKey, m, out, quoteKeys)
 				} else {
 					out[itemKey] = item
 				}
@@ -165,7 +422,7 @@ func flatten(prefix string, in map[string]interface{}, out map[string]interface{
 }
 
 func parseJSON(path string) (map[string]interface{}, error) {
-	b, err := os.ReadFile(path)
+	b, err := readInputBytes(path)
 	if err != nil {
 		return nil, err
 	}
@@ -176,27 +433,57 @@ func parseJSON(path string) (map[string]interface{}, error) {
 	return data, nil
 }
 
+// parseJSONDocuments reads a Vault-style JSON input that may be either a
+// single object or an array of objects, so reverse mode can symmetrically
+// round-trip a multi-document YAML file that was flattened to a JSON array.
+// path may be "-" to read from stdin.
+func parseJSONDocuments(path string) ([]map[string]interface{}, error) {
+	b, err := readInputBytes(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var arr []map[string]interface{}
+	if err := json.Unmarshal(b, &arr); err == nil {
+		return arr, nil
+	}
+
+	var obj map[string]interface{}
+	if err := json.Unmarshal(b, &obj); err != nil {
+		return nil, fmt.Errorf("expected a JSON object or array of objects: %w", err)
+	}
+	return []map[string]interface{}{obj}, nil
+}
+
+// writeEnv renders data as KEY="value" lines. path may be "-" to write to
+// stdout instead of a file.
 func writeEnv(data map[string]interface{}, path string) error {
 	var lines []string
 	keys := sortedKeys(data)
 	for _, k := range keys {
-		lines = append(lines, fmt.Sprintf(`%s="%v"`, k, data[k]))
+		v := data[k]
+		if v == nil {
+			v = ""
+		}
+		lines = append(lines, fmt.Sprintf(`%s="%v"`, k, v))
 	}
-	return os.WriteFile(path, []byte(strings.Join(lines, "\n")+"\n"), 0644)
+	return writeOutput(path, []byte(strings.Join(lines, "\n")+"\n"))
 }
 
+// writeYAML renders data as YAML. path may be "-" to write to stdout
+// instead of a file.
 func writeYAML(data map[string]interface{}, path string) error {
-	f, err := os.Create(path)
-	if err != nil {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(2)
+	if err := enc.Encode(data); err != nil {
+		enc.Close()
 		return err
 	}
-	defer f.Close()
-
-	enc := yaml.NewEncoder(f)
-	enc.SetIndent(2)
-	defer enc.Close()
-
-	return enc.Encode(data)
+	if err := enc.Close(); err != nil {
+		return err
+	}
+	return writeOutput(path, buf.Bytes())
 }
 
 func sortedKeys(m map[string]interface{}) []string {
@@ -207,30 +494,48 @@ func sortedKeys(m map[string]interface{}) []string {
 	sort.Strings(keys)
 	return keys
 }
-func unflatten(flat map[string]interface{}) map[string]interface{} {
+
+// unflattenOptions are the -quote-keys/-allow-sparse flags that affect how
+// a flat map is rebuilt into a nested structure.
+type unflattenOptions struct {
+	QuoteKeys   bool
+	AllowSparse bool
+}
+
+// unflatten rebuilds the nested map/array structure that flat's keys
+// describe. Unless opts.AllowSparse is set, it errors if doing so would
+// leave a gap in an array (a flat map with "items[0]" and "items[2]" but no
+// "items[1]"), since that's almost always a sign the keys were built or
+// edited by hand incorrectly rather than a real sparse array.
+func unflatten(flat map[string]interface{}, opts unflattenOptions) (map[string]interface{}, error) {
 	root := make(map[string]interface{})
 
 	for flatKey, value := range flat {
-		parts := strings.Split(flatKey, ".")
+		parts := splitFlatKey(flatKey, opts.QuoteKeys)
 		current := root
 
 		for i := 0; i < len(parts); i++ {
 			isLast := i == len(parts)-1
-			key, idx, isArray := parseArrayKey(parts[i])
+			key, idx, isArray := parts[i].Name, parts[i].Index, parts[i].HasIndex
+			if !parts[i].Quoted {
+				key, idx, isArray = parseArrayKey(parts[i].Name)
+			}
 
 			if isArray {
 				var arr []interface{}
 				if existing, ok := current[key]; ok {
 					arr, _ = existing.([]interface{})
 				}
-				// Ensure array size
+				// Ensure array size, marking newly-grown slots with
+				// arrayGapSentinel rather than a real nil so a later gap
+				// check can tell them apart from an explicit null value.
 				for len(arr) <= idx {
-					arr = append(arr, nil)
+					arr = append(arr, arrayGapSentinel)
 				}
 				if isLast {
 					arr[idx] = value
 				} else {
-					if arr[idx] == nil {
+					if arr[idx] == arrayGapSentinel {
 						arr[idx] = make(map[string]interface{})
 					}
 				}
@@ -253,7 +558,14 @@ func unflatten(flat map[string]interface{}) map[string]interface{} {
 		}
 	}
 
-	return root
+	if !opts.AllowSparse {
+		if err := validateNoArrayGaps(root, ""); err != nil {
+			return nil, err
+		}
+	}
+	fillArrayGaps(root)
+
+	return root, nil
 }
 
 func parseArrayKey(key string) (string, int, bool) {